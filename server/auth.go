@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identity describes who made a request, as resolved by an Authenticator.
+// Handlers can read it back via IdentityFromContext for quotas, audit
+// logging, etc.
+type Identity struct {
+	Name string
+}
+
+// Authenticator validates a request's credentials and resolves an Identity
+// for it.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// NoAuth lets every request through anonymously. It is the default used by
+// Mount when no Authenticator is configured.
+type NoAuth struct{}
+
+// Authenticate implements Authenticator.
+func (NoAuth) Authenticate(r *http.Request) (Identity, error) {
+	return Identity{}, nil
+}
+
+// BasicAuth authenticates requests carrying HTTP basic credentials against a
+// single configured username/password pair.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate implements Authenticator.
+func (b BasicAuth) Authenticate(r *http.Request) (Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, errors.New("missing basic auth credentials")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(username), []byte(b.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(b.Password)) != 1 {
+		return Identity{}, errors.New("invalid basic auth credentials")
+	}
+
+	return Identity{Name: username}, nil
+}
+
+// BearerToken authenticates requests carrying an "Authorization: Bearer ..."
+// header. With Token set it checks for that exact static token, reporting
+// Name (or "bearer" if Name is empty) as the Identity; with VerifyKey set it
+// instead verifies the header as an HS256 JWT signed with that key, rejects
+// expired tokens, and takes the Identity's Name from the token's "sub"
+// claim.
+type BearerToken struct {
+	Token     string
+	VerifyKey []byte
+	Name      string
+}
+
+// Authenticate implements Authenticator.
+func (b BearerToken) Authenticate(r *http.Request) (Identity, error) {
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == "" || token == auth {
+		return Identity{}, errors.New("missing bearer token")
+	}
+
+	if b.Token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(b.Token)) != 1 {
+			return Identity{}, errors.New("invalid bearer token")
+		}
+
+		name := b.Name
+		if name == "" {
+			name = "bearer"
+		}
+		return Identity{Name: name}, nil
+	}
+
+	return verifyJWT(token, b.VerifyKey)
+}
+
+// verifyJWT checks an HS256-signed JWT against key, rejects it if expired,
+// and returns an Identity built from its "sub" claim.
+func verifyJWT(token string, key []byte) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errors.New("malformed JWT")
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Identity{}, errors.New("invalid JWT header")
+	}
+
+	var alg struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &alg); err != nil {
+		return Identity{}, errors.New("invalid JWT header")
+	}
+	if alg.Alg != "HS256" {
+		return Identity{}, fmt.Errorf("unsupported JWT alg %q", alg.Alg)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	expected := mac.Sum(nil)
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, expected) {
+		return Identity{}, errors.New("invalid JWT signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, errors.New("invalid JWT payload")
+	}
+
+	var claims struct {
+		Subject   string `json:"sub"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, errors.New("invalid JWT claims")
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return Identity{}, errors.New("expired JWT")
+	}
+
+	return Identity{Name: claims.Subject}, nil
+}
+
+// identityContextKey is where authMiddleware stashes the Identity it
+// resolved, for IdentityFromContext to read back.
+const identityContextKey = "identity"
+
+// IdentityFromContext returns the Identity authMiddleware resolved for this
+// request, if any.
+func IdentityFromContext(ctx *gin.Context) (Identity, bool) {
+	v, ok := ctx.Get(identityContextKey)
+	if !ok {
+		return Identity{}, false
+	}
+
+	identity, ok := v.(Identity)
+	return identity, ok
+}
+
+// authMiddleware rejects requests an Authenticator can't validate, and makes
+// the resolved Identity available to later handlers.
+func authMiddleware(a Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		identity, err := a.Authenticate(ctx.Request)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, jsonError("unauthorized: %s", err))
+			return
+		}
+
+		ctx.Set(identityContextKey, identity)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,50 @@
+// Command bblfsh-dashboard serves the dashboard's JSON API. It does not
+// bundle the frontend (the generated server/asset package that ships the
+// built React app isn't part of this tree); it only wires server.Mount
+// behind a flag-configured *server.Server.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/bblfsh/dashboard/server"
+	"github.com/gin-gonic/gin"
+)
+
+var version = "dev"
+
+func main() {
+	addr := flag.String("addr", ":9999", "address in which the server will run")
+	bblfshAddr := flag.String("bblfsh-addr", "0.0.0.0:9432", "address of the babelfish server")
+	storageDir := flag.String("storage-dir", "", "directory to persist snippets in; if unset, snippets are kept in memory only")
+	debug := flag.Bool("debug", false, "run in debug mode")
+	flag.Parse()
+
+	if !*debug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	s, err := server.New(*bblfshAddr, version)
+	if err != nil {
+		log.Fatalf("error starting new server at %s: %s", *addr, err)
+	}
+
+	if *storageDir != "" {
+		storage, err := server.NewFilesystemStorage(*storageDir)
+		if err != nil {
+			log.Fatalf("error configuring --storage-dir=%s: %s", *storageDir, err)
+		}
+		s.SetStorage(storage)
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(gin.Logger())
+	server.Mount(s, r.Group("/api"))
+
+	log.Printf("starting REST server on %s", *addr)
+	if err := r.Run(*addr); err != nil {
+		log.Fatal(err)
+	}
+}
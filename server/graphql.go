@@ -0,0 +1,187 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// rootNodeKey is where the parsed UAST is stashed in the RootObject map
+// graphql-go requires at the top of the resolver tree.
+const rootNodeKey = "node"
+
+// property is a single entry of a uast.Node's Properties map, exposed as a
+// GraphQL list since GraphQL has no generic map type.
+type property struct {
+	Key   string
+	Value string
+}
+
+var propertyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Property",
+	Fields: graphql.Fields{
+		"key": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(property).Key, nil
+			},
+		},
+		"value": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(property).Value, nil
+			},
+		},
+	},
+})
+
+// nodeType mirrors uast.Node; it is declared upfront and its fields are
+// filled in below so "children" and "search" can reference it recursively.
+var nodeType = graphql.NewObject(graphql.ObjectConfig{
+	Name:   "Node",
+	Fields: graphql.Fields{},
+})
+
+func init() {
+	nodeType.AddFieldConfig("internalType", &graphql.Field{
+		Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return uastNode(p).InternalType, nil
+		},
+	})
+	nodeType.AddFieldConfig("token", &graphql.Field{
+		Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return uastNode(p).Token, nil
+		},
+	})
+	nodeType.AddFieldConfig("roles", &graphql.Field{
+		Type: graphql.NewList(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			n := uastNode(p)
+			roles := make([]string, len(n.Roles))
+			for i, r := range n.Roles {
+				roles[i] = r.String()
+			}
+			return roles, nil
+		},
+	})
+	nodeType.AddFieldConfig("properties", &graphql.Field{
+		Type: graphql.NewList(propertyType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			n := uastNode(p)
+			keys := make([]string, 0, len(n.Properties))
+			for k := range n.Properties {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			properties := make([]property, len(keys))
+			for i, k := range keys {
+				properties[i] = property{Key: k, Value: n.Properties[k]}
+			}
+			return properties, nil
+		},
+	})
+	nodeType.AddFieldConfig("children", &graphql.Field{
+		Type: graphql.NewList(nodeType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return uastNode(p).Children, nil
+		},
+	})
+	nodeType.AddFieldConfig("search", &graphql.Field{
+		Type: graphql.NewList(nodeType),
+		Args: graphql.FieldConfigArgument{
+			"xpath": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			xpath, _ := p.Args["xpath"].(string)
+			return tools.Filter(uastNode(p), xpath)
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: nodeType})
+	if err != nil {
+		panic(err)
+	}
+	uastSchema = schema
+}
+
+// uastNode recovers the *uast.Node a resolver should act on: the root
+// resolvers see the RootObject map graphql-go always hands to the top of
+// the tree, while every resolver below "children"/"search" sees the
+// *uast.Node its parent field resolved to.
+func uastNode(p graphql.ResolveParams) *uast.Node {
+	switch v := p.Source.(type) {
+	case *uast.Node:
+		return v
+	case map[string]interface{}:
+		if n, ok := v[rootNodeKey].(*uast.Node); ok {
+			return n
+		}
+	}
+	return &uast.Node{}
+}
+
+// uastSchema exposes the UAST of a single parsed file: the root Query type
+// is the Node type itself, so a client can ask for exactly the
+// fields/subtree it needs in one round-trip, including a search(xpath)
+// field that reuses the same XPath engine as /api/parse's query parameter.
+// graphql-go derives introspection (__schema, __type) for it automatically.
+// It is built at the end of the init() above, once nodeType's fields exist.
+var uastSchema graphql.Schema
+
+type graphqlRequest struct {
+	request
+	Language  string                 `json:"language"`
+	Filename  string                 `json:"filename"`
+	Content   string                 `json:"content"`
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// HandleGraphQL parses the given source once and executes a GraphQL query
+// against the resulting UAST, as an alternative to the XPath-only query
+// parameter HandleParse supports.
+func (s *Server) HandleGraphQL(ctx *gin.Context) {
+	var req graphqlRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, jsonError("unable to read request: %s", err))
+		return
+	}
+
+	cli, err := s.clientForRequest(req.request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error starting client: %s", err))
+		return
+	}
+
+	resp, err := cli.NewParseRequest().
+		Language(req.Language).
+		Filename(req.Filename).
+		Content(req.Content).
+		Do()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error parsing UAST: %s", err))
+		return
+	}
+	if resp.Status != protocol.Ok {
+		ctx.JSON(toHTTPStatus(resp.Status), (*ParseResponse)(resp))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         uastSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		RootObject:     map[string]interface{}{rootNodeKey: resp.UAST},
+		Context:        ctx.Request.Context(),
+	})
+
+	ctx.JSON(http.StatusOK, result)
+}
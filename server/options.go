@@ -0,0 +1,30 @@
+package server
+
+// mountConfig holds the configurable pieces Mount wires as middleware.
+// It is built from the Options passed to Mount and is never exposed
+// directly.
+type mountConfig struct {
+	auth Authenticator
+	cors *CORSConfig
+}
+
+// Option configures Mount. Use WithAuthenticator and WithCORS to opt into
+// authentication and cross-origin support; with no options Mount behaves
+// exactly as before (no auth, no CORS headers).
+type Option func(*mountConfig)
+
+// WithAuthenticator makes Mount authenticate every request with a before
+// serving it. Identity is then available to handlers via IdentityFromContext.
+func WithAuthenticator(a Authenticator) Option {
+	return func(c *mountConfig) {
+		c.auth = a
+	}
+}
+
+// WithCORS makes Mount answer cross-origin requests (including preflight
+// OPTIONS requests) according to cfg.
+func WithCORS(cfg CORSConfig) Option {
+	return func(c *mountConfig) {
+		c.cors = &cfg
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/bblfsh/client-go.v2"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+type Server struct {
+	client     *bblfsh.Client
+	httpClient *http.Client
+	version    string
+	storage    Storage
+}
+
+func New(addr string, version string) (*Server, error) {
+	client, err := bblfsh.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		client:     client,
+		version:    version,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		storage:    NewMemoryStorage(),
+	}, nil
+}
+
+// SetStorage replaces the backend used for /snippet routes. By default New
+// sets up a MemoryStorage; call this to switch to a FilesystemStorage or a
+// GistStorage instead. The bblfsh-dashboard binary's --storage-dir flag
+// selects FilesystemStorage this way; other embedders construct and set
+// whichever backend they want.
+func (s *Server) SetStorage(storage Storage) {
+	s.storage = storage
+}
+
+// Mount exposes the gRPC bblfsh protocol (Parse, NativeParse and Version) as
+// a JSON/REST surface, in addition to the dashboard-only endpoints
+// (drivers, gist, snippet). Every gRPC-backed route shares the same request
+// envelope and status-to-HTTP-code mapping, so a client can treat them
+// uniformly. By default every route is open and unrestricted; pass
+// WithAuthenticator and/or WithCORS to lock them down.
+func Mount(s *Server, r gin.IRouter, opts ...Option) gin.IRouter {
+	cfg := &mountConfig{auth: NoAuth{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.cors != nil {
+		r.Use(corsMiddleware(*cfg.cors))
+	}
+	r.Use(authMiddleware(cfg.auth))
+
+	r.POST("/parse", s.HandleParse)
+	r.POST("/native-parse", s.HandleNativeParse)
+	r.POST("/graphql", s.HandleGraphQL)
+	r.GET("/drivers", s.ListDrivers)
+	r.GET("/gist", s.LoadGist)
+	r.POST("/snippet", s.SaveSnippet)
+	r.GET("/snippet/:id", s.LoadSnippet)
+	r.POST("/version", s.Version)
+	r.GET("/parse/stream", s.HandleParseStream)
+
+	if cfg.cors != nil {
+		// Routes only get the middleware above for methods they're
+		// registered under, so a browser's OPTIONS preflight needs an
+		// explicit handler per path; corsMiddleware itself answers it.
+		noop := func(ctx *gin.Context) {}
+		for _, path := range []string{"/parse", "/native-parse", "/graphql", "/drivers", "/gist", "/snippet", "/snippet/:id", "/version"} {
+			r.OPTIONS(path, noop)
+		}
+	}
+
+	return r
+}
+
+type request struct {
+	ServerURL string `json:"server_url"`
+}
+
+type parseRequest struct {
+	request
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+	Query    string `json:"query"`
+}
+
+// HandleParse reads the whole request body into a parseRequest via BindJSON
+// and the UAST response into a *ParseResponse before writing it out; large
+// files are buffered in full rather than streamed through. This isn't just a
+// handler shortcut: gopkg.in/bblfsh/sdk.v1/protocol's ProtocolService.Parse
+// is itself a unary, single-request/single-response gRPC method, so bblfsh's
+// client-go.v2 client has no streaming call to forward into in the first
+// place. Avoiding the double buffer would need a streaming RPC added to the
+// bblfsh protocol upstream; /api/parse/stream (HandleParseStream) works
+// around this for the editor's use case by keeping only the latest edit in
+// flight rather than by streaming bytes.
+func (s *Server) HandleParse(ctx *gin.Context) {
+	var req parseRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, jsonError("unable to read request: %s", err))
+		return
+	}
+
+	cli, err := s.clientForRequest(req.request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error starting client: %s", err))
+		return
+	}
+
+	resp, err := cli.NewParseRequest().
+		Language(req.Language).
+		Filename(req.Filename).
+		Content(req.Content).
+		Do()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error parsing UAST: %s", err))
+		return
+	}
+
+	if resp.UAST != nil && req.Query != "" {
+		filtered, err := tools.Filter(resp.UAST, req.Query)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, jsonError("error filtering UAST: %s", err))
+			return
+		}
+		resp.UAST = &uast.Node{
+			InternalType: "Dashboard: Search results",
+			Children:     filtered,
+		}
+	}
+
+	ctx.JSON(toHTTPStatus(resp.Status), (*ParseResponse)(resp))
+}
+
+type nativeParseRequest struct {
+	request
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// HandleNativeParse exposes the driver-level AST, as opposed to HandleParse
+// which returns the UAST. It takes the same request envelope as
+// HandleParse, minus the UAST-only Query field, and has the same
+// fully-buffered request/response handling as HandleParse, for the same
+// reason: ProtocolService.NativeParse is unary too.
+func (s *Server) HandleNativeParse(ctx *gin.Context) {
+	var req nativeParseRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, jsonError("unable to read request: %s", err))
+		return
+	}
+
+	cli, err := s.clientForRequest(req.request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error starting client: %s", err))
+		return
+	}
+
+	resp, err := cli.NewNativeParseRequest().
+		Language(req.Language).
+		Filename(req.Filename).
+		Content(req.Content).
+		Do()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error parsing AST: %s", err))
+		return
+	}
+
+	ctx.JSON(toHTTPStatus(resp.Status), (*NativeParseResponse)(resp))
+}
+
+func (s *Server) clientForRequest(req request) (*bblfsh.Client, error) {
+	if req.ServerURL == "" {
+		return s.client, nil
+	}
+
+	return bblfsh.NewClient(req.ServerURL)
+}
+
+// MakeGistURL makes url to github's gust
+// export to allow mocking in test
+var MakeGistURL = func(u string) string {
+	return "https://gist.githubusercontent.com/" + u
+}
+
+func (s *Server) LoadGist(ctx *gin.Context) {
+	resp, err := s.httpClient.Get(MakeGistURL(ctx.Query("url")))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, jsonError("Gist not found: %s", err))
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		ctx.JSON(http.StatusNotFound, jsonError("Gist not found"))
+		return
+	}
+	defer resp.Body.Close()
+
+	gistContent, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("Could not read gist: %s", err))
+		return
+	}
+
+	ctx.String(resp.StatusCode, string(gistContent))
+}
+
+type versionRequest struct {
+	request
+}
+
+func (s *Server) Version(ctx *gin.Context) {
+	var req versionRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, jsonError("unable to read request: %s", err))
+		return
+	}
+
+	cli, err := s.clientForRequest(req.request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error starting client: %s", err))
+		return
+	}
+
+	resp, err := cli.NewVersionRequest().Do()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error getting server version: %s", err))
+		return
+	}
+
+	ctx.JSON(toHTTPStatus(resp.Status), map[string]string{
+		"dashboard": s.version,
+		"server":    resp.Version,
+	})
+}
+
+func (s *Server) ListDrivers(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, driverList)
+}
+
+func toHTTPStatus(status protocol.Status) int {
+	switch status {
+	case protocol.Ok:
+		return http.StatusOK
+	case protocol.Error:
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func jsonError(msg string, args ...interface{}) gin.H {
+	return gin.H{
+		"status": protocol.Fatal,
+		"errors": []gin.H{
+			gin.H{
+				"message": fmt.Sprintf(msg, args...),
+			},
+		},
+	}
+}
+
+type ParseResponse protocol.ParseResponse
+
+func (r *ParseResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		*protocol.ParseResponse
+		UAST *Node `json:"uast"`
+	}{
+		(*protocol.ParseResponse)(r),
+		(*Node)(r.UAST),
+	}
+
+	return json.Marshal(resp)
+}
+
+type NativeParseResponse protocol.NativeParseResponse
+
+// MarshalJSON embeds the driver's AST as a JSON object rather than as the
+// double-encoded string protocol.NativeParseResponse carries it in.
+func (r *NativeParseResponse) MarshalJSON() ([]byte, error) {
+	ast := json.RawMessage(r.AST)
+	if len(ast) == 0 {
+		ast = json.RawMessage("null")
+	}
+
+	resp := struct {
+		*protocol.NativeParseResponse
+		AST json.RawMessage `json:"ast"`
+	}{
+		(*protocol.NativeParseResponse)(r),
+		ast,
+	}
+
+	return json.Marshal(resp)
+}
+
+type Node uast.Node
+
+func (n *Node) MarshalJSON() ([]byte, error) {
+	var nodes = make([]*Node, len(n.Children))
+	for i, n := range n.Children {
+		nodes[i] = (*Node)(n)
+	}
+
+	var roles = make([]string, len(n.Roles))
+	for i, r := range n.Roles {
+		roles[i] = r.String()
+	}
+
+	node := struct {
+		*uast.Node
+		Roles    []string
+		Children []*Node
+	}{
+		(*uast.Node)(n),
+		roles,
+		nodes,
+	}
+
+	return json.Marshal(node)
+}
@@ -1,15 +1,26 @@
 package server_test
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bblfsh/dashboard/server"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"gopkg.in/bblfsh/sdk.v1/protocol"
@@ -65,6 +76,39 @@ func TestHandleParseSuccess(t *testing.T) {
 	}`, w.Body.String())
 }
 
+func TestHandleNativeParseSuccess(t *testing.T) {
+	var req *protocol.NativeParseRequest
+
+	require := require.New(t)
+	s := &bblfshServiceMock{
+		NativeParseFunc: func(r *protocol.NativeParseRequest) *protocol.NativeParseResponse {
+			req = r
+			return &protocol.NativeParseResponse{
+				Response: protocol.Response{Status: protocol.Ok},
+				AST:      `{"ast_type": "Module"}`,
+				Language: "python",
+			}
+		},
+	}
+
+	input := `{"language": "python", "filename": "file.py", "content": "foo = 1"}`
+	w, err := request(s, "POST", "/api/native-parse", strings.NewReader(input))
+	require.Nil(err)
+	require.Equal(http.StatusOK, w.Code)
+	// check correct input parsing
+	require.Equal("python", req.Language)
+	require.Equal("file.py", req.Filename)
+	require.Equal("foo = 1", req.Content)
+	// check resp transformation
+	require.JSONEq(`{
+		"status": 0,
+		"errors": null,
+		"elapsed": 0,
+		"language": "python",
+		"ast": {"ast_type": "Module"}
+	}`, w.Body.String())
+}
+
 func TestHandleParseWithQuerySuccess(t *testing.T) {
 	require := require.New(t)
 	s := &bblfshServiceMock{
@@ -96,6 +140,59 @@ func TestHandleParseWithQuerySuccess(t *testing.T) {
 	}`, w.Body.String())
 }
 
+func TestHandleGraphQLSuccess(t *testing.T) {
+	require := require.New(t)
+	s := &bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			return &protocol.ParseResponse{
+				Response: protocol.Response{Status: protocol.Ok},
+				UAST:     serverUAST,
+				Language: "python",
+			}
+		},
+	}
+
+	input := `{"filename": "file.py", "content": "foo = 1", "query": "{ internalType, roles, children { internalType, roles } }"}`
+	w, err := request(s, "POST", "/api/graphql", strings.NewReader(input))
+	require.Nil(err)
+	require.Equal(http.StatusOK, w.Code)
+	require.JSONEq(`{
+		"data": {
+			"internalType": "Root",
+			"roles": ["File"],
+			"children": [
+				{"internalType": "Child1", "roles": ["Argument", "Import"]},
+				{"internalType": "Child2", "roles": ["Alias"]}
+			]
+		}
+	}`, w.Body.String())
+}
+
+func TestHandleGraphQLSearch(t *testing.T) {
+	require := require.New(t)
+	s := &bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			return &protocol.ParseResponse{
+				Response: protocol.Response{Status: protocol.Ok},
+				UAST:     serverUAST,
+				Language: "python",
+			}
+		},
+	}
+
+	input := `{"filename": "file.py", "content": "foo = 1", "query": "{ search(xpath: \"//*[@roleAlias]\") { internalType } }"}`
+	w, err := request(s, "POST", "/api/graphql", strings.NewReader(input))
+	require.Nil(err)
+	require.Equal(http.StatusOK, w.Code)
+	require.JSONEq(`{
+		"data": {
+			"search": [
+				{"internalType": "Child2"}
+			]
+		}
+	}`, w.Body.String())
+}
+
 func TestHandleParseEmptyWithQuery(t *testing.T) {
 	require := require.New(t)
 	s := &bblfshServiceMock{
@@ -119,6 +216,84 @@ func TestHandleParseEmptyWithQuery(t *testing.T) {
 	}`, w.Body.String())
 }
 
+func TestHandleParseStreamCoalesces(t *testing.T) {
+	require := require.New(t)
+
+	// ParseFunc blocks on the first ("foo = 1") request until the test
+	// releases it, so seq 2 and 3 are guaranteed to arrive and be coalesced
+	// while the consumer is still busy with seq 1.
+	started := make(chan struct{})
+	var startOnce sync.Once
+	release := make(chan struct{})
+
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			if r.Content == "foo = 1" {
+				startOnce.Do(func() { close(started) })
+				<-release
+			}
+			return &protocol.ParseResponse{
+				Response: protocol.Response{Status: protocol.Ok},
+				UAST:     serverUAST,
+				Language: r.Language,
+			}
+		},
+	})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGin(srv)
+	require.Nil(err)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/parse/stream"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Nil(err)
+	defer conn.Close()
+
+	send := func(seq int64, content string) {
+		require.Nil(conn.WriteJSON(map[string]interface{}{
+			"language": "python",
+			"filename": "file.py",
+			"content":  content,
+			"seq":      seq,
+		}))
+	}
+
+	send(1, "foo = 1")
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("seq 1 was never picked up for processing")
+	}
+
+	// Both land while the consumer is still stuck processing seq 1, so seq
+	// 2 must be dropped in favor of seq 3, per stream.go's coalescing rule.
+	// The short sleeps give readStreamRequests time to actually read each
+	// frame off the socket before the next one is sent, so seq 2 is queued
+	// and then superseded rather than raced by seq 3's arrival.
+	send(2, "foo = 2")
+	time.Sleep(50 * time.Millisecond)
+	send(3, "foo = 3")
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.Nil(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	var seqs []int64
+	for len(seqs) < 2 {
+		var resp map[string]interface{}
+		require.Nil(conn.ReadJSON(&resp))
+		seqs = append(seqs, int64(resp["seq"].(float64)))
+	}
+
+	require.Equal([]int64{1, 3}, seqs)
+}
+
 func TestLoadGistSuccess(t *testing.T) {
 	require := require.New(t)
 
@@ -151,6 +326,254 @@ func TestLoadGistSuccess(t *testing.T) {
 	server.MakeGistURL = origURLMaker
 }
 
+func TestSnippetSaveAndLoadSuccess(t *testing.T) {
+	require := require.New(t)
+
+	// Saving and loading a snippet needs the same Server (and so the same
+	// Storage) across both calls, so this can't use the request() helper,
+	// which spins up a fresh one each time.
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGin(srv)
+	require.Nil(err)
+
+	input := `{"language": "python", "filename": "file.py", "content": "foo = 1"}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/snippet", strings.NewReader(input))
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+
+	var saved struct {
+		ID string `json:"id"`
+	}
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &saved))
+	require.NotEmpty(saved.ID)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/snippet/"+saved.ID, nil)
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+	require.JSONEq(input, w.Body.String())
+}
+
+func TestGistStorageLoadSuccess(t *testing.T) {
+	require := require.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/path/to/correct/gist" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("foo = 1"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	origURLMaker := server.MakeGistURL
+	server.MakeGistURL = func(p string) string {
+		return ts.URL + "/" + p
+	}
+	defer func() { server.MakeGistURL = origURLMaker }()
+
+	storage := server.NewGistStorage(ts.Client())
+
+	snip, err := storage.Load(context.Background(), "path/to/correct/gist")
+	require.Nil(err)
+	require.Equal("foo = 1", snip.Content)
+
+	_, err = storage.Load(context.Background(), "does/not/exist")
+	require.NotNil(err)
+
+	_, err = storage.Save(context.Background(), server.Snippet{Content: "foo = 1"})
+	require.Equal(server.ErrReadOnlyStorage, err)
+}
+
+func TestFilesystemStorageRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "dashboard-storage")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	storage, err := server.NewFilesystemStorage(dir)
+	require.Nil(err)
+
+	snip := server.Snippet{Language: "python", Filename: "file.py", Content: "foo = 1"}
+	id, err := storage.Save(context.Background(), snip)
+	require.Nil(err)
+	require.NotEmpty(id)
+
+	loaded, err := storage.Load(context.Background(), id)
+	require.Nil(err)
+	require.Equal(snip, loaded)
+
+	_, err = storage.Load(context.Background(), "does-not-exist")
+	require.NotNil(err)
+
+	_, err = server.NewFilesystemStorage(filepath.Join(dir, "does-not-exist"))
+	require.NotNil(err)
+}
+
+func TestSnippetLoadNotFound(t *testing.T) {
+	require := require.New(t)
+
+	s := &bblfshServiceMock{}
+	w, err := request(s, "GET", "/api/snippet/does-not-exist", nil)
+	require.Nil(err)
+	require.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestHandleParseUnauthorized(t *testing.T) {
+	require := require.New(t)
+
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			return &protocol.ParseResponse{Response: protocol.Response{Status: protocol.Ok}}
+		},
+	})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGinWithOptions(srv, server.WithAuthenticator(server.BasicAuth{Username: "alice", Password: "secret"}))
+	require.Nil(err)
+
+	input := `{"language": "python", "filename": "file.py", "content": "foo = 1"}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+	req.SetBasicAuth("alice", "secret")
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+}
+
+func TestHandleParseBearerTokenStatic(t *testing.T) {
+	require := require.New(t)
+
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			return &protocol.ParseResponse{Response: protocol.Response{Status: protocol.Ok}}
+		},
+	})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGinWithOptions(srv, server.WithAuthenticator(server.BearerToken{Token: "secret-token"}))
+	require.Nil(err)
+
+	input := `{"language": "python", "filename": "file.py", "content": "foo = 1"}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	r.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+}
+
+// hs256JWT builds a minimal HS256 JWT for testing BearerToken's JWT path.
+func hs256JWT(key []byte, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ := json.Marshal(claims)
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleParseBearerTokenJWT(t *testing.T) {
+	require := require.New(t)
+
+	key := []byte("jwt-signing-key")
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{
+		ParseFunc: func(r *protocol.ParseRequest) *protocol.ParseResponse {
+			return &protocol.ParseResponse{Response: protocol.Response{Status: protocol.Ok}}
+		},
+	})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGinWithOptions(srv, server.WithAuthenticator(server.BearerToken{VerifyKey: key}))
+	require.Nil(err)
+
+	input := `{"language": "python", "filename": "file.py", "content": "foo = 1"}`
+	post := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/parse", strings.NewReader(input))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	valid := hs256JWT(key, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	require.Equal(http.StatusOK, post(valid))
+
+	expired := hs256JWT(key, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+	require.Equal(http.StatusUnauthorized, post(expired))
+
+	wrongKey := hs256JWT([]byte("not-the-key"), map[string]interface{}{"sub": "alice"})
+	require.Equal(http.StatusUnauthorized, post(wrongKey))
+
+	require.Equal(http.StatusUnauthorized, post(""))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	require := require.New(t)
+
+	grpcServer, addr, err := runBblfsh(&bblfshServiceMock{})
+	require.Nil(err)
+	defer grpcServer.GracefulStop()
+	srv, err := server.New(addr, "dashboard-ver")
+	require.Nil(err)
+	r, err := runGinWithOptions(srv, server.WithCORS(server.CORSConfig{
+		AllowedOrigins: []string{"https://example.org"},
+		AllowedMethods: []string{"POST"},
+		AllowedHeaders: []string{"Content-Type"},
+	}))
+	require.Nil(err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/api/parse", nil)
+	req.Header.Set("Origin", "https://example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	r.ServeHTTP(w, req)
+
+	require.Equal(http.StatusNoContent, w.Code)
+	require.Equal("https://example.org", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal("POST", w.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal("Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/api/parse", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	r.ServeHTTP(w, req)
+	require.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+}
+
 func TestVersionsSuccess(t *testing.T) {
 	require := require.New(t)
 	s := &bblfshServiceMock{
@@ -183,6 +606,16 @@ func TestHandleVersionsError(t *testing.T) {
 	require.Equal(http.StatusBadRequest, w.Code)
 }
 
+func TestHandleVersionsUnreachableServerURL(t *testing.T) {
+	require := require.New(t)
+	s := &bblfshServiceMock{}
+
+	input := `{"server_url": "localhost:1"}`
+	w, err := request(s, "POST", "/api/version", strings.NewReader(input))
+	require.Nil(err)
+	require.Equal(http.StatusInternalServerError, w.Code)
+}
+
 func TestCustomBblfshServer(t *testing.T) {
 	require := require.New(t)
 
@@ -267,6 +700,14 @@ func runGin(s *server.Server) (*gin.Engine, error) {
 	return r, nil
 }
 
+func runGinWithOptions(s *server.Server, opts ...server.Option) (*gin.Engine, error) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	server.Mount(s, r.Group("/api"), opts...)
+
+	return r, nil
+}
+
 type bblfshServiceMock struct {
 	ParseFunc       func(*protocol.ParseRequest) *protocol.ParseResponse
 	NativeParseFunc func(*protocol.NativeParseRequest) *protocol.NativeParseResponse
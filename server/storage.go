@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Snippet is a shareable piece of source code, as saved/loaded through
+// Storage.
+type Snippet struct {
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// Storage persists and retrieves Snippets, so the dashboard can share code
+// samples without depending on GitHub Gists being reachable.
+type Storage interface {
+	Save(ctx context.Context, s Snippet) (id string, err error)
+	Load(ctx context.Context, id string) (Snippet, error)
+}
+
+// ErrReadOnlyStorage is returned by Storage implementations that can only
+// Load, never Save.
+var ErrReadOnlyStorage = errors.New("storage is read-only")
+
+func newSnippetID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryStorage keeps Snippets in memory; they do not survive a restart.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	snippets map[string]Snippet
+}
+
+// NewMemoryStorage returns a Storage backed by an in-memory map.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{snippets: make(map[string]Snippet)}
+}
+
+// Save implements Storage.
+func (m *MemoryStorage) Save(ctx context.Context, s Snippet) (string, error) {
+	id, err := newSnippetID()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.snippets[id] = s
+	m.mu.Unlock()
+
+	return id, nil
+}
+
+// Load implements Storage.
+func (m *MemoryStorage) Load(ctx context.Context, id string) (Snippet, error) {
+	m.mu.Lock()
+	s, ok := m.snippets[id]
+	m.mu.Unlock()
+	if !ok {
+		return Snippet{}, fmt.Errorf("snippet %q not found", id)
+	}
+
+	return s, nil
+}
+
+// FilesystemStorage persists Snippets as JSON files under a directory, one
+// file per snippet.
+type FilesystemStorage struct {
+	dir string
+}
+
+// NewFilesystemStorage returns a Storage backed by dir, which must already
+// exist and be writable.
+func NewFilesystemStorage(dir string) (*FilesystemStorage, error) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("storage dir %q: %s", dir, err)
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("storage dir %q is not a directory", dir)
+	}
+
+	return &FilesystemStorage{dir: dir}, nil
+}
+
+func (f *FilesystemStorage) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+// Save implements Storage.
+func (f *FilesystemStorage) Save(ctx context.Context, s Snippet) (string, error) {
+	id, err := newSnippetID()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(f.path(id), content, 0644); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Load implements Storage.
+func (f *FilesystemStorage) Load(ctx context.Context, id string) (Snippet, error) {
+	content, err := ioutil.ReadFile(f.path(id))
+	if err != nil {
+		return Snippet{}, fmt.Errorf("snippet %q not found: %s", id, err)
+	}
+
+	var s Snippet
+	if err := json.Unmarshal(content, &s); err != nil {
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
+
+// GistStorage loads Snippets from GitHub Gists. It is read-only: gists are
+// created on github.com, not through the dashboard.
+type GistStorage struct {
+	httpClient *http.Client
+}
+
+// NewGistStorage returns a Storage that loads snippets from
+// gist.githubusercontent.com, through MakeGistURL.
+func NewGistStorage(httpClient *http.Client) *GistStorage {
+	return &GistStorage{httpClient: httpClient}
+}
+
+// Save implements Storage. Gists can't be created through this backend.
+func (g *GistStorage) Save(ctx context.Context, s Snippet) (string, error) {
+	return "", ErrReadOnlyStorage
+}
+
+// Load implements Storage. id is the gist path, as passed to MakeGistURL.
+func (g *GistStorage) Load(ctx context.Context, id string) (Snippet, error) {
+	resp, err := g.httpClient.Get(MakeGistURL(id))
+	if err != nil {
+		return Snippet{}, fmt.Errorf("Gist not found: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Snippet{}, errors.New("Gist not found")
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Snippet{}, fmt.Errorf("Could not read gist: %s", err)
+	}
+
+	return Snippet{Content: string(content)}, nil
+}
+
+type snippetRequest struct {
+	Snippet
+}
+
+// SaveSnippet persists the posted snippet through the configured Storage
+// and returns the id it was saved under.
+func (s *Server) SaveSnippet(ctx *gin.Context) {
+	var req snippetRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, jsonError("unable to read request: %s", err))
+		return
+	}
+
+	id, err := s.storage.Save(ctx.Request.Context(), req.Snippet)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, jsonError("error saving snippet: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// LoadSnippet retrieves a previously saved snippet by id.
+func (s *Server) LoadSnippet(ctx *gin.Context) {
+	snip, err := s.storage.Load(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, jsonError("snippet not found: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, snip)
+}
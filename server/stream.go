@@ -0,0 +1,136 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// streamUpgrader upgrades /parse/stream connections. CheckOrigin is left at
+// the library default, which rejects an upgrade whose Origin host differs
+// from the request's Host; WithCORS does not change this, so cross-origin
+// WebSocket connections are refused either way.
+var streamUpgrader = websocket.Upgrader{}
+
+// streamRequest is one frame of a /parse/stream request: the same
+// language/filename/content/query fields as parseRequest (there is no
+// server_url), plus a client-assigned Seq used to drop superseded requests.
+type streamRequest struct {
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+	Query    string `json:"query"`
+	Seq      int64  `json:"seq"`
+}
+
+// streamResponse is one frame of a /parse/stream response: a ParseResponse
+// tagged with the Seq of the request it answers.
+type streamResponse struct {
+	Seq      int64           `json:"seq"`
+	Status   protocol.Status `json:"status"`
+	Errors   []string        `json:"errors"`
+	Elapsed  time.Duration   `json:"elapsed"`
+	Language string          `json:"language"`
+	UAST     *Node           `json:"uast"`
+}
+
+// HandleParseStream upgrades the request to a WebSocket and serves a stream
+// of parses over it: the client sends a streamRequest per edit and gets back
+// a streamResponse, using the same language/filename/content/query fields
+// and XPath-query post-processing as HandleParse. All frames on a socket
+// share the one upstream gRPC client s already holds. If edits arrive faster
+// than they can be parsed, only the latest one in flight is kept; superseded
+// requests are dropped rather than queued.
+func (s *Server) HandleParseStream(ctx *gin.Context) {
+	conn, err := streamUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	pending := make(chan streamRequest, 1)
+	go readStreamRequests(conn, pending)
+
+	for req := range pending {
+		resp := s.parseStreamRequest(req)
+		if err := conn.WriteJSON(resp); err != nil {
+			return
+		}
+	}
+}
+
+// readStreamRequests decodes frames off conn and feeds them into pending,
+// keeping only the most recent one waiting: if the consumer is still busy
+// with an older request when a newer one arrives, the older queued one is
+// replaced rather than processed. A frame whose Seq is not greater than the
+// last one read is out of order and is dropped.
+func readStreamRequests(conn *websocket.Conn, pending chan streamRequest) {
+	defer close(pending)
+
+	var lastSeq int64
+	seen := false
+	for {
+		var req streamRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		if seen && req.Seq <= lastSeq {
+			continue
+		}
+		lastSeq, seen = req.Seq, true
+
+		select {
+		case pending <- req:
+		default:
+			select {
+			case <-pending:
+			default:
+			}
+			pending <- req
+		}
+	}
+}
+
+func (s *Server) parseStreamRequest(req streamRequest) streamResponse {
+	resp, err := s.client.NewParseRequest().
+		Language(req.Language).
+		Filename(req.Filename).
+		Content(req.Content).
+		Do()
+	if err != nil {
+		return streamResponse{
+			Seq:    req.Seq,
+			Status: protocol.Fatal,
+			Errors: []string{err.Error()},
+		}
+	}
+
+	if resp.UAST != nil && req.Query != "" {
+		filtered, err := tools.Filter(resp.UAST, req.Query)
+		if err != nil {
+			return streamResponse{
+				Seq:    req.Seq,
+				Status: protocol.Fatal,
+				Errors: []string{err.Error()},
+			}
+		}
+		resp.UAST = &uast.Node{
+			InternalType: "Dashboard: Search results",
+			Children:     filtered,
+		}
+	}
+
+	return streamResponse{
+		Seq:      req.Seq,
+		Status:   resp.Status,
+		Errors:   resp.Errors,
+		Elapsed:  resp.Elapsed,
+		Language: resp.Language,
+		UAST:     (*Node)(resp.UAST),
+	}
+}